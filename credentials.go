@@ -0,0 +1,325 @@
+package s3url
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// CredentialSourceKind identifies where an S3Config's credentials should come
+// from when they aren't already present in AccessKeyId/SecretKey.
+type CredentialSourceKind string
+
+const (
+	// CredentialSourceInline is the zero value: AccessKeyId/SecretKey were
+	// taken literally from the URN's userinfo section and need no further
+	// resolution.
+	CredentialSourceInline CredentialSourceKind = ""
+	// CredentialSourceChain means no userinfo was present at all; Resolve
+	// tries env, the default shared credentials profile, then IMDS in turn.
+	CredentialSourceChain CredentialSourceKind = "chain"
+	// CredentialSourceEnv reads AWS_ACCESS_KEY_ID/AWS_SECRET_ACCESS_KEY (and
+	// AWS_SESSION_TOKEN) from the environment, e.g. s3://env@endpoint/bucket/.
+	CredentialSourceEnv CredentialSourceKind = "env"
+	// CredentialSourceProfile reads a named profile from the shared
+	// credentials file, e.g. s3://profile:default@endpoint/bucket/.
+	CredentialSourceProfile CredentialSourceKind = "profile"
+	// CredentialSourceFile reads the default profile out of an arbitrary
+	// credentials file, e.g. s3://file:[/path/to/creds]@endpoint/bucket/.
+	// The path must be bracketed since an unescaped leading '/' would
+	// otherwise terminate the URL authority before reaching '@'.
+	CredentialSourceFile CredentialSourceKind = "file"
+	// CredentialSourceIMDS fetches temporary credentials from the EC2/ECS
+	// instance metadata service, e.g. s3://imds@endpoint/bucket/.
+	CredentialSourceIMDS CredentialSourceKind = "imds"
+)
+
+// CredentialSource records where Resolve should fetch credentials from when
+// an S3Config's URN didn't carry an access key and secret key directly.
+type CredentialSource struct {
+	Kind CredentialSourceKind
+	// Profile is the shared credentials file profile name, set for
+	// CredentialSourceProfile.
+	Profile string
+	// Path is the credentials file path, set for CredentialSourceFile.
+	Path string
+}
+
+// credentialsFileSections is a parsed shared-credentials-style ini file:
+// section name (the default, unlabeled section is "") to key/value pairs.
+type credentialsFileSections map[string]map[string]string
+
+// parseCredentialsFile does a minimal parse of the ini-like format used by
+// ~/.aws/credentials: "[section]" headers and "key = value" assignments.
+func parseCredentialsFile(path string) (credentialsFileSections, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to open credentials file %s", path)
+	}
+	defer file.Close()
+
+	sections := credentialsFileSections{}
+	section := ""
+	sections[section] = map[string]string{}
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") {
+			continue
+		}
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			section = strings.TrimSpace(line[1 : len(line)-1])
+			if _, ok := sections[section]; !ok {
+				sections[section] = map[string]string{}
+			}
+			continue
+		}
+		key, value, found := strings.Cut(line, "=")
+		if !found {
+			continue
+		}
+		sections[section][strings.TrimSpace(key)] = strings.TrimSpace(value)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Wrapf(err, "failed to read credentials file %s", path)
+	}
+
+	return sections, nil
+}
+
+// credentialsFromSection extracts aws_access_key_id/aws_secret_access_key
+// (and aws_session_token, if present) out of a parsed ini section.
+func credentialsFromSection(section map[string]string) (accessKeyId, secretKey, sessionToken string, err error) {
+	accessKeyId = section["aws_access_key_id"]
+	secretKey = section["aws_secret_access_key"]
+	sessionToken = section["aws_session_token"]
+	if accessKeyId == "" || secretKey == "" {
+		return "", "", "", errors.New("credentials section is missing aws_access_key_id or aws_secret_access_key")
+	}
+	return accessKeyId, secretKey, sessionToken, nil
+}
+
+// defaultSharedCredentialsFile returns ~/.aws/credentials, honoring the same
+// AWS_SHARED_CREDENTIALS_FILE override the AWS CLI/SDKs respect.
+func defaultSharedCredentialsFile() (string, error) {
+	if path := os.Getenv("AWS_SHARED_CREDENTIALS_FILE"); path != "" {
+		return path, nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", errors.Wrap(err, "failed to determine home directory for the shared credentials file")
+	}
+	return filepath.Join(home, ".aws", "credentials"), nil
+}
+
+// resolveFromEnv fills in credentials from AWS_ACCESS_KEY_ID/AWS_SECRET_ACCESS_KEY,
+// and AWS_SESSION_TOKEN if it's also set.
+func (s3Config *S3Config) resolveFromEnv() error {
+	accessKeyId := os.Getenv("AWS_ACCESS_KEY_ID")
+	secretKey := os.Getenv("AWS_SECRET_ACCESS_KEY")
+	if accessKeyId == "" || secretKey == "" {
+		return errors.New("AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY must both be set")
+	}
+	s3Config.AccessKeyId = accessKeyId
+	s3Config.SecretKey = secretKey
+	s3Config.SessionToken = os.Getenv("AWS_SESSION_TOKEN")
+	return nil
+}
+
+// resolveFromProfile fills in credentials from the named profile in the
+// shared credentials file.
+func (s3Config *S3Config) resolveFromProfile(profile string) error {
+	path, err := defaultSharedCredentialsFile()
+	if err != nil {
+		return err
+	}
+	sections, err := parseCredentialsFile(path)
+	if err != nil {
+		return err
+	}
+	section, ok := sections[profile]
+	if !ok {
+		return errors.Errorf("profile %q not found in %s", profile, path)
+	}
+	accessKeyId, secretKey, sessionToken, err := credentialsFromSection(section)
+	if err != nil {
+		return errors.Wrapf(err, "profile %q in %s", profile, path)
+	}
+	s3Config.AccessKeyId = accessKeyId
+	s3Config.SecretKey = secretKey
+	s3Config.SessionToken = sessionToken
+	return nil
+}
+
+// resolveFromFile fills in credentials from the default section of an
+// arbitrary credentials file.
+func (s3Config *S3Config) resolveFromFile(path string) error {
+	sections, err := parseCredentialsFile(path)
+	if err != nil {
+		return err
+	}
+	section, ok := sections[""]
+	if !ok || len(section) == 0 {
+		section, ok = sections["default"]
+	}
+	if !ok {
+		return errors.Errorf("no credentials found in %s", path)
+	}
+	accessKeyId, secretKey, sessionToken, err := credentialsFromSection(section)
+	if err != nil {
+		return errors.Wrapf(err, "file %s", path)
+	}
+	s3Config.AccessKeyId = accessKeyId
+	s3Config.SecretKey = secretKey
+	s3Config.SessionToken = sessionToken
+	return nil
+}
+
+const (
+	imdsBaseURL     = "http://169.254.169.254/latest"
+	imdsHTTPTimeout = 5 * time.Second
+)
+
+// imdsCredentials mirrors the JSON body returned by IMDS for a role's
+// temporary credentials.
+type imdsCredentials struct {
+	AccessKeyId     string
+	SecretAccessKey string
+	Token           string
+}
+
+// resolveFromIMDS fills in temporary credentials from the EC2/ECS instance
+// metadata service using the IMDSv2 token flow.
+func (s3Config *S3Config) resolveFromIMDS(ctx context.Context) error {
+	client := &http.Client{Timeout: imdsHTTPTimeout}
+
+	tokenReq, err := http.NewRequestWithContext(ctx, http.MethodPut, imdsBaseURL+"/api/token", nil)
+	if err != nil {
+		return errors.Wrap(err, "failed to build IMDS token request")
+	}
+	tokenReq.Header.Set("X-aws-ec2-metadata-token-ttl-seconds", "21600")
+	tokenResp, err := client.Do(tokenReq)
+	if err != nil {
+		return errors.Wrap(err, "failed to reach IMDS token endpoint")
+	}
+	defer tokenResp.Body.Close()
+	tokenBytes, err := io.ReadAll(tokenResp.Body)
+	if err != nil {
+		return errors.Wrap(err, "failed to read IMDS token")
+	}
+	token := string(tokenBytes)
+
+	roleReq, err := http.NewRequestWithContext(ctx, http.MethodGet, imdsBaseURL+"/meta-data/iam/security-credentials/", nil)
+	if err != nil {
+		return errors.Wrap(err, "failed to build IMDS role request")
+	}
+	roleReq.Header.Set("X-aws-ec2-metadata-token", token)
+	roleResp, err := client.Do(roleReq)
+	if err != nil {
+		return errors.Wrap(err, "failed to reach IMDS role endpoint")
+	}
+	defer roleResp.Body.Close()
+	roleBytes, err := io.ReadAll(roleResp.Body)
+	if err != nil {
+		return errors.Wrap(err, "failed to read IMDS role")
+	}
+	role := strings.TrimSpace(string(roleBytes))
+	if role == "" {
+		return errors.New("no IAM role attached to this instance")
+	}
+
+	credsReq, err := http.NewRequestWithContext(ctx, http.MethodGet, imdsBaseURL+"/meta-data/iam/security-credentials/"+role, nil)
+	if err != nil {
+		return errors.Wrap(err, "failed to build IMDS credentials request")
+	}
+	credsReq.Header.Set("X-aws-ec2-metadata-token", token)
+	credsResp, err := client.Do(credsReq)
+	if err != nil {
+		return errors.Wrap(err, "failed to reach IMDS credentials endpoint")
+	}
+	defer credsResp.Body.Close()
+
+	var creds imdsCredentials
+	if err := json.NewDecoder(credsResp.Body).Decode(&creds); err != nil {
+		return errors.Wrap(err, "failed to decode IMDS credentials")
+	}
+	if creds.AccessKeyId == "" || creds.SecretAccessKey == "" {
+		return errors.New("IMDS returned no credentials")
+	}
+
+	s3Config.AccessKeyId = creds.AccessKeyId
+	s3Config.SecretKey = creds.SecretAccessKey
+	s3Config.SessionToken = creds.Token
+	return nil
+}
+
+// resolveChain tries env, then the default shared credentials profile, then
+// IMDS, in that order, succeeding on the first source that resolves.
+func (s3Config *S3Config) resolveChain(ctx context.Context) error {
+	var errs []string
+
+	if err := s3Config.resolveFromEnv(); err != nil {
+		errs = append(errs, "env: "+err.Error())
+	} else {
+		return nil
+	}
+
+	if err := s3Config.resolveFromProfile("default"); err != nil {
+		errs = append(errs, "profile:default: "+err.Error())
+	} else {
+		return nil
+	}
+
+	if err := s3Config.resolveFromIMDS(ctx); err != nil {
+		errs = append(errs, "imds: "+err.Error())
+	} else {
+		return nil
+	}
+
+	return errors.Errorf("no credential source in the chain resolved: %s", strings.Join(errs, "; "))
+}
+
+// Resolve fills in AccessKeyId/SecretKey from CredentialSource (a no-op if
+// they were already set inline) and returns a config that passes
+// ValidateResolved. It walks env vars, the shared credentials file, and
+// EC2/ECS IMDS in turn for CredentialSourceChain.
+func (s3Config S3Config) Resolve(ctx context.Context) (S3Config, error) {
+	if err := s3Config.ValidateShape(); err != nil {
+		return s3Config, err
+	}
+
+	var err error
+	switch s3Config.CredentialSource.Kind {
+	case CredentialSourceInline:
+		// Already resolved from the URN's userinfo.
+	case CredentialSourceEnv:
+		err = s3Config.resolveFromEnv()
+	case CredentialSourceProfile:
+		err = s3Config.resolveFromProfile(s3Config.CredentialSource.Profile)
+	case CredentialSourceFile:
+		err = s3Config.resolveFromFile(s3Config.CredentialSource.Path)
+	case CredentialSourceIMDS:
+		err = s3Config.resolveFromIMDS(ctx)
+	case CredentialSourceChain:
+		err = s3Config.resolveChain(ctx)
+	default:
+		err = errors.Errorf("unknown credential source %q", s3Config.CredentialSource.Kind)
+	}
+	if err != nil {
+		return s3Config, err
+	}
+
+	if err := s3Config.ValidateResolved(); err != nil {
+		return s3Config, err
+	}
+	return s3Config, nil
+}
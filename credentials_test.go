@@ -0,0 +1,125 @@
+package s3url
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestResolveEnvCredentialSource(t *testing.T) {
+	config, err := Parse("s3://env@endpoint/bucket/prefix/")
+	require.NoError(t, err)
+
+	t.Setenv("AWS_ACCESS_KEY_ID", "envAccessKey")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "envSecretKey")
+	t.Setenv("AWS_SESSION_TOKEN", "envSessionToken")
+
+	resolved, err := config.Resolve(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, "envAccessKey", resolved.AccessKeyId)
+	require.Equal(t, "envSecretKey", resolved.SecretKey)
+	require.Equal(t, "envSessionToken", resolved.SessionToken)
+	require.NoError(t, resolved.ValidateResolved())
+}
+
+func TestResolveEnvCredentialSourceMissing(t *testing.T) {
+	config, err := Parse("s3://env@endpoint/bucket/prefix/")
+	require.NoError(t, err)
+
+	t.Setenv("AWS_ACCESS_KEY_ID", "")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "")
+
+	_, err = config.Resolve(context.Background())
+	require.Error(t, err)
+}
+
+func TestResolveProfileCredentialSource(t *testing.T) {
+	credsPath := filepath.Join(t.TempDir(), "credentials")
+	err := os.WriteFile(credsPath, []byte(""+
+		"[default]\n"+
+		"aws_access_key_id = defaultAccessKey\n"+
+		"aws_secret_access_key = defaultSecretKey\n"+
+		"\n"+
+		"[staging]\n"+
+		"aws_access_key_id = stagingAccessKey\n"+
+		"aws_secret_access_key = stagingSecretKey\n",
+	), 0o600)
+	require.NoError(t, err)
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", credsPath)
+
+	config, err := Parse("s3://profile:staging@endpoint/bucket/prefix/")
+	require.NoError(t, err)
+
+	resolved, err := config.Resolve(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, "stagingAccessKey", resolved.AccessKeyId)
+	require.Equal(t, "stagingSecretKey", resolved.SecretKey)
+}
+
+func TestResolveProfileCredentialSourceWithSessionToken(t *testing.T) {
+	credsPath := filepath.Join(t.TempDir(), "credentials")
+	err := os.WriteFile(credsPath, []byte(""+
+		"[sts]\n"+
+		"aws_access_key_id = stsAccessKey\n"+
+		"aws_secret_access_key = stsSecretKey\n"+
+		"aws_session_token = stsSessionToken\n",
+	), 0o600)
+	require.NoError(t, err)
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", credsPath)
+
+	config, err := Parse("s3://profile:sts@endpoint/bucket/prefix/")
+	require.NoError(t, err)
+
+	resolved, err := config.Resolve(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, "stsAccessKey", resolved.AccessKeyId)
+	require.Equal(t, "stsSecretKey", resolved.SecretKey)
+	require.Equal(t, "stsSessionToken", resolved.SessionToken)
+}
+
+func TestResolveProfileCredentialSourceUnknownProfile(t *testing.T) {
+	credsPath := filepath.Join(t.TempDir(), "credentials")
+	err := os.WriteFile(credsPath, []byte("[default]\naws_access_key_id = a\naws_secret_access_key = b\n"), 0o600)
+	require.NoError(t, err)
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", credsPath)
+
+	config, err := Parse("s3://profile:missing@endpoint/bucket/prefix/")
+	require.NoError(t, err)
+
+	_, err = config.Resolve(context.Background())
+	require.Error(t, err)
+}
+
+func TestResolveFileCredentialSource(t *testing.T) {
+	credsPath := filepath.Join(t.TempDir(), "creds")
+	err := os.WriteFile(credsPath, []byte("aws_access_key_id = fileAccessKey\naws_secret_access_key = fileSecretKey\n"), 0o600)
+	require.NoError(t, err)
+
+	config, err := Parse("s3://file:[" + credsPath + "]@endpoint/bucket/prefix/")
+	require.NoError(t, err)
+
+	resolved, err := config.Resolve(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, "fileAccessKey", resolved.AccessKeyId)
+	require.Equal(t, "fileSecretKey", resolved.SecretKey)
+}
+
+func TestResolveInlineCredentialSourceIsNoop(t *testing.T) {
+	config, err := Parse("s3://accessKey123:secretKey123@endpoint/bucket/prefix/")
+	require.NoError(t, err)
+
+	resolved, err := config.Resolve(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, config, resolved)
+}
+
+func TestValidateShapeAllowsUnresolvedCredentials(t *testing.T) {
+	config, err := Parse("s3://env@endpoint/bucket/prefix/")
+	require.NoError(t, err)
+
+	require.NoError(t, config.ValidateShape())
+	require.Error(t, config.ValidateResolved())
+}
@@ -0,0 +1,116 @@
+package s3url
+
+import "github.com/pkg/errors"
+
+// splitTopLevel splits value on "," or "|", ignoring occurrences inside
+// [bracketed] credential segments so a literal comma or pipe in a
+// bracket-escaped access key/secret key doesn't get mistaken for a
+// delimiter between URLs.
+func splitTopLevel(value string) []string {
+	var parts []string
+	depth := 0
+	start := 0
+
+	for i, r := range value {
+		switch r {
+		case '[':
+			depth++
+		case ']':
+			if depth > 0 {
+				depth--
+			}
+		case ',', '|':
+			if depth == 0 {
+				parts = append(parts, value[start:i])
+				start = i + 1
+			}
+		}
+	}
+	parts = append(parts, value[start:])
+
+	return parts
+}
+
+// ParseMany parses a comma- or pipe-separated list of s3:// URLs (e.g. a
+// primary plus its mirrors), or a single s3:// URL carrying a
+// mirror=s3://... query param, into one S3Config per entry.
+func ParseMany(value string) ([]S3Config, error) {
+	var configs []S3Config
+
+	for _, urn := range splitTopLevel(value) {
+		if urn == "" {
+			continue
+		}
+
+		config, err := Parse(urn)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to parse %q", urn)
+		}
+		configs = append(configs, config)
+
+		if mirrors := config.Params.Get("mirror"); mirrors != "" {
+			config.Params.Del("mirror")
+			mirrorConfigs, err := ParseMany(mirrors)
+			if err != nil {
+				return nil, errors.Wrapf(err, "failed to parse mirror= on %q", urn)
+			}
+			configs = append(configs, mirrorConfigs...)
+		}
+	}
+
+	if len(configs) == 0 {
+		return nil, errors.New("no s3:// URLs found to parse")
+	}
+
+	return configs, nil
+}
+
+// MultiConfig groups a primary S3Config with its mirrors, letting a tool
+// address more than one S3-compatible backend from a single connection
+// string instead of inventing its own delimiter format on top of Parse.
+type MultiConfig struct {
+	Configs []S3Config
+}
+
+// ParseMultiConfig is ParseMany wrapped in a MultiConfig, for callers that
+// want the grouped type rather than a bare slice.
+func ParseMultiConfig(value string) (MultiConfig, error) {
+	configs, err := ParseMany(value)
+	if err != nil {
+		return MultiConfig{}, err
+	}
+	return MultiConfig{Configs: configs}, nil
+}
+
+// Validate rejects duplicate Bucket+EndpointHost pairs among Configs and
+// requires every entry to share the same Prefix, unless one of the entries
+// sets allowPrefixDrift=1 in its query params.
+func (m MultiConfig) Validate() error {
+	if len(m.Configs) == 0 {
+		return errors.New("MultiConfig must contain at least one S3Config")
+	}
+
+	allowPrefixDrift := false
+	for _, config := range m.Configs {
+		if config.Params.Get("allowPrefixDrift") == "1" {
+			allowPrefixDrift = true
+			break
+		}
+	}
+
+	prefix := m.Configs[0].Prefix
+	seen := make(map[string]bool, len(m.Configs))
+	for _, config := range m.Configs {
+		key := config.Bucket + "@" + config.EndpointHost
+		if seen[key] {
+			return errors.Errorf("duplicate bucket %q on endpoint %q", config.Bucket, config.EndpointHost)
+		}
+		seen[key] = true
+
+		if !allowPrefixDrift && config.Prefix != prefix {
+			return errors.Errorf("prefix %q on endpoint %q does not match the primary prefix %q, set allowPrefixDrift=1 to allow it", config.Prefix, config.EndpointHost, prefix)
+		}
+	}
+
+	return nil
+}
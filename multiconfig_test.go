@@ -0,0 +1,85 @@
+package s3url
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseManyCommaSeparated(t *testing.T) {
+	configs, err := ParseMany("s3://accessKey1:secretKey1@endpoint1/bucket1/prefix/,s3://accessKey2:secretKey2@endpoint2/bucket2/prefix/")
+	require.NoError(t, err)
+	require.Len(t, configs, 2)
+	require.Equal(t, "endpoint1", configs[0].EndpointHost)
+	require.Equal(t, "endpoint2", configs[1].EndpointHost)
+}
+
+func TestParseManyPipeSeparated(t *testing.T) {
+	configs, err := ParseMany("s3://accessKey1:secretKey1@endpoint1/bucket1/prefix/|s3://accessKey2:secretKey2@endpoint2/bucket2/prefix/")
+	require.NoError(t, err)
+	require.Len(t, configs, 2)
+	require.Equal(t, "endpoint1", configs[0].EndpointHost)
+	require.Equal(t, "endpoint2", configs[1].EndpointHost)
+}
+
+func TestParseManyBracketedCredentialWithComma(t *testing.T) {
+	configs, err := ParseMany("s3://[access,Key1]:secretKey1@endpoint1/bucket1/prefix/")
+	require.NoError(t, err)
+	require.Len(t, configs, 1)
+	require.Equal(t, "access,Key1", configs[0].AccessKeyId)
+}
+
+func TestParseManyMirrorQueryParam(t *testing.T) {
+	configs, err := ParseMany("s3://accessKey1:secretKey1@endpoint1/bucket1/prefix/?mirror=s3%3A%2F%2FaccessKey2%3AsecretKey2%40endpoint2%2Fbucket2%2Fprefix%2F")
+	require.NoError(t, err)
+	require.Len(t, configs, 2)
+	require.Equal(t, "endpoint1", configs[0].EndpointHost)
+	require.Equal(t, "endpoint2", configs[1].EndpointHost)
+	require.Empty(t, configs[0].Params.Get("mirror"))
+}
+
+func TestParseManyPropagatesParseError(t *testing.T) {
+	_, err := ParseMany("s3://accessKey1:secretKey1@endpoint1/bucket1/prefix/,not-a-urn")
+	require.Error(t, err)
+}
+
+func TestParseManyEmptyValue(t *testing.T) {
+	_, err := ParseMany("")
+	require.Error(t, err)
+}
+
+func TestMultiConfigValidateRejectsDuplicateBucketAndEndpoint(t *testing.T) {
+	configs, err := ParseMany("s3://accessKey1:secretKey1@endpoint1/bucket1/prefix/,s3://accessKey2:secretKey2@endpoint1/bucket1/prefix/")
+	require.NoError(t, err)
+
+	multi := MultiConfig{Configs: configs}
+	require.Error(t, multi.Validate())
+}
+
+func TestMultiConfigValidateRequiresSharedPrefix(t *testing.T) {
+	configs, err := ParseMany("s3://accessKey1:secretKey1@endpoint1/bucket1/prefixA/,s3://accessKey2:secretKey2@endpoint2/bucket2/prefixB/")
+	require.NoError(t, err)
+
+	multi := MultiConfig{Configs: configs}
+	require.Error(t, multi.Validate())
+}
+
+func TestMultiConfigValidateAllowsPrefixDriftWhenSet(t *testing.T) {
+	configs, err := ParseMany("s3://accessKey1:secretKey1@endpoint1/bucket1/prefixA/,s3://accessKey2:secretKey2@endpoint2/bucket2/prefixB/?allowPrefixDrift=1")
+	require.NoError(t, err)
+
+	multi := MultiConfig{Configs: configs}
+	require.NoError(t, multi.Validate())
+}
+
+func TestMultiConfigValidateRequiresAtLeastOneConfig(t *testing.T) {
+	multi := MultiConfig{}
+	require.Error(t, multi.Validate())
+}
+
+func TestParseMultiConfig(t *testing.T) {
+	multi, err := ParseMultiConfig("s3://accessKey1:secretKey1@endpoint1/bucket1/prefix/,s3://accessKey2:secretKey2@endpoint2/bucket2/prefix/")
+	require.NoError(t, err)
+	require.NoError(t, multi.Validate())
+	require.Len(t, multi.Configs, 2)
+}
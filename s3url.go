@@ -2,62 +2,288 @@ package s3url
 
 import (
 	"github.com/pkg/errors"
+	"net"
 	"net/url"
 	"regexp"
+	"strconv"
 	"strings"
 )
 
 type S3Config struct {
-	AccessKeyId  string
-	SecretKey    string
-	Bucket       string
-	Prefix       string
-	Endpoint     string
-	EndpointHost string
+	AccessKeyId      string
+	SecretKey        string
+	SessionToken     string
+	Bucket           string
+	Prefix           string
+	Endpoint         string
+	EndpointHost     string
+	Region           string
+	CredentialSource CredentialSource
+	// VersionId, Tagging, SSE, SSEKMSKeyId, StorageClass, and ACL are the S3
+	// request modifiers common enough to warrant a typed field instead of
+	// living in Params; anything else stays in Params.
+	VersionId    string
+	Tagging      string
+	SSE          string
+	SSEKMSKeyId  string
+	StorageClass string
+	ACL          string
 	Params       url.Values
 }
 
-// Validate the S3Config
-func (s3Config S3Config) Validate() error {
+// awsRegionRegex matches AWS region names (e.g. us-east-1, eu-west-2,
+// cn-north-1, us-gov-west-1) so a bare region can be recognized in the host
+// position, mirroring the s3://region/bucket convention used elsewhere.
+var awsRegionRegex = regexp.MustCompile(`^(?:us|eu|ap|sa|ca|me|af|cn)(?:-gov)?-[a-z]+-\d$`)
+
+// isAWSHostname reports whether host looks like a real AWS S3 endpoint.
+func isAWSHostname(host string) bool {
+	return strings.HasSuffix(host, ".amazonaws.com") || strings.HasSuffix(host, ".amazonaws.com.cn")
+}
+
+// ValidateShape checks the structural validity of the S3Config: bucket and
+// endpoint are set, the transport/hostname combination makes sense, and
+// CredentialSource is internally consistent. It does not require credentials
+// to already be resolved, so a config built for env/profile/file/imds/chain
+// resolution can still be validated, serialized, and passed around before
+// Resolve fills in AccessKeyId/SecretKey.
+func (s3Config S3Config) ValidateShape() error {
+	if s3Config.Bucket == "" {
+		return errors.New("s3Config.BucketName must not be empty")
+	}
+	if s3Config.Endpoint == "" {
+		return errors.New("s3Config.Endpoint must not be empty")
+	}
+	if s3Config.EndpointHost == "" {
+		return errors.New("s3Config.EndpointHost must not be empty")
+	}
+	if strings.Contains(s3Config.EndpointHost, "@") {
+		return errors.New("s3Config.EndpointHost must not contain '@'; the URN's userinfo section was likely malformed")
+	}
+	// net.SplitHostPort understands bracketed IPv6 literals (e.g. [::1] or
+	// [::1]:8080), unlike a bare strings.LastIndex(host, ":") split, which
+	// would mistake the address's own colons for a port separator.
+	if _, port, err := net.SplitHostPort(s3Config.EndpointHost); err != nil {
+		if addrErr, ok := err.(*net.AddrError); !ok || addrErr.Err != "missing port in address" {
+			return errors.New("s3Config.EndpointHost has a malformed host:port")
+		}
+	} else if _, err := strconv.Atoi(port); err != nil {
+		return errors.New("s3Config.EndpointHost has a malformed host:port")
+	}
+	if strings.HasPrefix(s3Config.Endpoint, "http://") &&
+		(isAWSHostname(s3Config.EndpointHost) || awsRegionRegex.MatchString(s3Config.EndpointHost)) {
+		return errors.New("s3Config.Endpoint must use s3:// or s3+https://, not s3+http://, with a real AWS hostname or region")
+	}
+
+	switch s3Config.CredentialSource.Kind {
+	case CredentialSourceInline:
+		if s3Config.AccessKeyId == "" {
+			return errors.New("s3Config.AccessKeyId must not be empty")
+		}
+		if s3Config.SecretKey == "" {
+			return errors.New("s3Config.SecretKey must not be empty")
+		}
+	case CredentialSourceProfile:
+		if s3Config.CredentialSource.Profile == "" {
+			return errors.New("s3Config.CredentialSource.Profile must not be empty")
+		}
+	case CredentialSourceFile:
+		if s3Config.CredentialSource.Path == "" {
+			return errors.New("s3Config.CredentialSource.Path must not be empty")
+		}
+	case CredentialSourceEnv, CredentialSourceIMDS, CredentialSourceChain:
+		// No further fields required.
+	default:
+		return errors.Errorf("unknown s3Config.CredentialSource.Kind %q", s3Config.CredentialSource.Kind)
+	}
+
+	return nil
+}
+
+// ValidateResolved checks ValidateShape and additionally requires that
+// AccessKeyId/SecretKey are populated, i.e. that Resolve has already run (or
+// the config was built with inline credentials to begin with).
+func (s3Config S3Config) ValidateResolved() error {
+	if err := s3Config.ValidateShape(); err != nil {
+		return err
+	}
 	if s3Config.AccessKeyId == "" {
 		return errors.New("s3Config.AccessKeyId must not be empty")
 	}
 	if s3Config.SecretKey == "" {
 		return errors.New("s3Config.SecretKey must not be empty")
 	}
-	if s3Config.Bucket == "" {
-		return errors.New("s3Config.BucketName must not be empty")
+	return nil
+}
+
+// Validate is an alias for ValidateResolved, kept for backwards
+// compatibility with callers that only ever used inline credentials.
+func (s3Config S3Config) Validate() error {
+	return s3Config.ValidateResolved()
+}
+
+// credentialEscapeChars are the characters that make a credential ambiguous
+// (or subject to unwanted percent-decoding) if placed unwrapped into the
+// s3://accesskey:secretkey@... userinfo, so Format bracket-wraps around them
+// the same way Parse expects.
+var credentialEscapeChars = regexp.MustCompile(`[:/@?&=\\\[\]%]`)
+
+// escapeCredential wraps value in brackets if it contains any character that
+// would otherwise be ambiguous in the s3://accesskey:secretkey@... userinfo.
+func escapeCredential(value string) string {
+	if credentialEscapeChars.MatchString(value) {
+		return "[" + value + "]"
 	}
-	if s3Config.Endpoint == "" {
-		return errors.New("s3Config.Endpoint must not be empty")
+	return value
+}
+
+// String reconstructs the canonical s3:// URL for the config, returning an
+// empty string if the config is not complete enough to format. Use Format to
+// get the error.
+func (s3Config S3Config) String() string {
+	formatted, err := s3Config.Format()
+	if err != nil {
+		return ""
 	}
-	return nil
+	return formatted
+}
+
+// Format reconstructs the canonical s3:// URL for the config, the inverse of
+// Parse. Credentials containing URL-unsafe characters are bracket-escaped,
+// Params are re-emitted as the query string, and anyPrefix=1 is re-added when
+// Prefix does not end in a slash. A CredentialSource other than
+// CredentialSourceInline is reconstructed as its userinfo shorthand (env@,
+// profile:name@, file:[path]@, imds@) rather than literal keys, so an
+// unresolved config only needs to pass ValidateShape to be formatted. A
+// CredentialSourceInline SessionToken is reconstructed as a third bracketed
+// userinfo segment; for any other CredentialSource it is re-emitted as the
+// sessionToken query param instead, since there's no userinfo section to
+// carry it.
+func (s3Config S3Config) Format() (string, error) {
+	if err := s3Config.ValidateShape(); err != nil {
+		return "", err
+	}
+
+	var urn strings.Builder
+	if strings.HasPrefix(s3Config.Endpoint, "http://") {
+		urn.WriteString("s3+http://")
+	} else {
+		urn.WriteString("s3://")
+	}
+	switch s3Config.CredentialSource.Kind {
+	case CredentialSourceInline:
+		urn.WriteString(escapeCredential(s3Config.AccessKeyId))
+		urn.WriteByte(':')
+		urn.WriteString(escapeCredential(s3Config.SecretKey))
+		if s3Config.SessionToken != "" {
+			urn.WriteByte(':')
+			urn.WriteString(escapeCredential(s3Config.SessionToken))
+		}
+		urn.WriteByte('@')
+	case CredentialSourceEnv:
+		urn.WriteString("env@")
+	case CredentialSourceIMDS:
+		urn.WriteString("imds@")
+	case CredentialSourceProfile:
+		urn.WriteString("profile:" + s3Config.CredentialSource.Profile + "@")
+	case CredentialSourceFile:
+		urn.WriteString("file:" + escapeCredential(s3Config.CredentialSource.Path) + "@")
+	case CredentialSourceChain:
+		// No userinfo section at all.
+	}
+	urn.WriteString(s3Config.EndpointHost)
+	urn.WriteByte('/')
+	urn.WriteString(s3Config.Bucket)
+	if s3Config.Prefix != "" {
+		urn.WriteByte('/')
+		urn.WriteString(s3Config.Prefix)
+	}
+
+	values := url.Values{}
+	for key, vals := range s3Config.Params {
+		values[key] = vals
+	}
+	if s3Config.Prefix != "" && !strings.HasSuffix(s3Config.Prefix, "/") {
+		values.Set("anyPrefix", "1")
+	}
+	// The host-as-region convention already carries the region; only fall
+	// back to the query param when the host doesn't already say so.
+	if s3Config.Region != "" && s3Config.Region != s3Config.EndpointHost {
+		values.Set("region", s3Config.Region)
+	}
+	if s3Config.CredentialSource.Kind != CredentialSourceInline && s3Config.SessionToken != "" {
+		values.Set("sessionToken", s3Config.SessionToken)
+	}
+	if s3Config.VersionId != "" {
+		values.Set("versionId", s3Config.VersionId)
+	}
+	if s3Config.Tagging != "" {
+		values.Set("tagging", s3Config.Tagging)
+	}
+	if s3Config.SSE != "" {
+		values.Set("sse", s3Config.SSE)
+	}
+	if s3Config.SSEKMSKeyId != "" {
+		values.Set("sseKmsKeyId", s3Config.SSEKMSKeyId)
+	}
+	if s3Config.StorageClass != "" {
+		values.Set("storageClass", s3Config.StorageClass)
+	}
+	if s3Config.ACL != "" {
+		values.Set("acl", s3Config.ACL)
+	}
+	if len(values) > 0 {
+		urn.WriteByte('?')
+		urn.WriteString(values.Encode())
+	}
+
+	return urn.String(), nil
 }
 
 // Parse takes a s3://accesskey:secretket@endpoint/bucket/...prefix and returns a S3Config
 // the accesskey and secret key can be wrapped with [ and ] to allow for special characters
+// The scheme may also be s3+http:// or s3+https:// to select the transport used to build
+// Endpoint; a region= query param or a bare AWS region name in the host position (e.g.
+// s3://key:secret@us-east-1/bucket/) populates Region. A third bracketed userinfo segment
+// (s3://key:secret:[token]@...) or a sessionToken=/X-Amz-Security-Token query param
+// populates SessionToken, and versionId/tagging/sse/sseKmsKeyId/storageClass/acl query
+// params populate their matching typed fields instead of staying in Params.
 func Parse(value string) (S3Config, error) {
 	var s3Config S3Config
 	var err error
 
 	// Don't get cute with parsing, just swap the custom stuff (bracket pairs) with url encoded values and hand off to url.Parse
-	accessKeyRegex := regexp.MustCompile(`s3://(\[.+?\]):`)
-	secretKeyRegex := regexp.MustCompile(`s3://.+?:(\[.+?\])@`)
-	encodedUrn := accessKeyRegex.ReplaceAllStringFunc(value, func(wrappedKey string) string {
-		res := accessKeyRegex.FindStringSubmatch(wrappedKey)
+	accessKeyRegex := regexp.MustCompile(`s3(?:\+https?)?://(\[.+?\]):`)
+	// secretKeyRegex matches the segment right after the access key, whether
+	// it's terminated by '@' (no session token) or ':' (a third bracketed
+	// session token segment follows).
+	secretKeyRegex := regexp.MustCompile(`s3(?:\+https?)?://.+?:(\[.+?\])[:@]`)
+	// sessionTokenRegex matches a third bracketed userinfo segment
+	// immediately before '@'; only present in s3://key:secret:[token]@ URNs.
+	sessionTokenRegex := regexp.MustCompile(`:(\[.+?\])@`)
+	// fileSourceRegex matches the bracketed path in a
+	// s3://file:[/path/to/creds]@... userinfo. The path must be bracketed
+	// because, unescaped, a leading '/' right after "file:" would terminate
+	// the URL authority before reaching '@'.
+	fileSourceRegex := regexp.MustCompile(`s3(?:\+https?)?://file:(\[.+?\])@`)
+	unwrapBracket := func(wrappedKey string, re *regexp.Regexp) string {
+		res := re.FindStringSubmatch(wrappedKey)
 		if len(res) < 2 {
 			return wrappedKey
 		}
-		key := strings.Replace(wrappedKey, res[1], url.QueryEscape(strings.Trim(res[1], "[]")), 1)
-		return key
+		return strings.Replace(wrappedKey, res[1], url.QueryEscape(strings.Trim(res[1], "[]")), 1)
+	}
+	encodedUrn := accessKeyRegex.ReplaceAllStringFunc(value, func(wrappedKey string) string {
+		return unwrapBracket(wrappedKey, accessKeyRegex)
 	})
 	encodedUrn = secretKeyRegex.ReplaceAllStringFunc(encodedUrn, func(wrappedKey string) string {
-		res := secretKeyRegex.FindStringSubmatch(wrappedKey)
-		if len(res) < 2 {
-			return wrappedKey
-		}
-		key := strings.Replace(wrappedKey, res[1], url.QueryEscape(strings.Trim(res[1], "[]")), 1)
-		return key
+		return unwrapBracket(wrappedKey, secretKeyRegex)
+	})
+	encodedUrn = sessionTokenRegex.ReplaceAllStringFunc(encodedUrn, func(wrappedKey string) string {
+		return unwrapBracket(wrappedKey, sessionTokenRegex)
+	})
+	encodedUrn = fileSourceRegex.ReplaceAllStringFunc(encodedUrn, func(wrappedKey string) string {
+		return unwrapBracket(wrappedKey, fileSourceRegex)
 	})
 
 	// Parse the URN using the url package.
@@ -66,18 +292,57 @@ func Parse(value string) (S3Config, error) {
 		return s3Config, errors.Wrap(err, "failed to parse the URN")
 	}
 
-	if parsedUrl.Scheme != "s3" {
-		return s3Config, errors.New("invalid scheme in the URN. Expecting s3://")
+	var protocol string
+	switch parsedUrl.Scheme {
+	case "s3", "s3+https":
+		protocol = "https"
+	case "s3+http":
+		protocol = "http"
+	default:
+		return s3Config, errors.New("invalid scheme in the URN. Expecting s3://, s3+http://, or s3+https://")
 	}
 
-	// Extract credentials from the URL
-	accessKeyID, secretKey := "", ""
+	// Extract credentials from the URL, or record a deferred CredentialSource
+	// when the userinfo section names a source instead of literal keys.
+	accessKeyID, secretKey, sessionToken := "", "", ""
+	credentialSource := CredentialSource{Kind: CredentialSourceChain}
 	if parsedUrl.User != nil {
-		accessKeyID = parsedUrl.User.Username()
-		var isSet bool
-		secretKey, isSet = parsedUrl.User.Password()
-		if !isSet {
-			return s3Config, errors.New("missing secret key in the URN")
+		username := parsedUrl.User.Username()
+		password, isSet := parsedUrl.User.Password()
+
+		switch username {
+		case "env":
+			credentialSource = CredentialSource{Kind: CredentialSourceEnv}
+		case "imds":
+			credentialSource = CredentialSource{Kind: CredentialSourceIMDS}
+		case "profile":
+			profile := password
+			if !isSet || profile == "" {
+				profile = "default"
+			}
+			credentialSource = CredentialSource{Kind: CredentialSourceProfile, Profile: profile}
+		case "file":
+			if !isSet || password == "" {
+				return s3Config, errors.New("file credential source requires a bracketed path, e.g. s3://file:[/path/to/creds]@...")
+			}
+			credentialSource = CredentialSource{Kind: CredentialSourceFile, Path: password}
+		default:
+			if !isSet {
+				return s3Config, errors.New("missing secret key in the URN")
+			}
+			accessKeyID = username
+			secretKey = password
+			// A third bracketed segment (s3://key:secret:[token]@...) carries
+			// a session token; Password() returns the whole remainder after
+			// the first colon, so split it off the secret key here.
+			if idx := strings.Index(password, ":"); idx >= 0 {
+				secretKey = password[:idx]
+				sessionToken = password[idx+1:]
+				if sessionToken == "" {
+					return s3Config, errors.New("empty session token in the URN")
+				}
+			}
+			credentialSource = CredentialSource{Kind: CredentialSourceInline}
 		}
 	}
 
@@ -106,19 +371,65 @@ func Parse(value string) (S3Config, error) {
 	}
 
 	values.Del("anyPrefix")
+
+	// A region= query param wins; otherwise fall back to the s3://region/bucket
+	// convention where the host position holds a bare AWS region name.
+	region := values.Get("region")
+	values.Del("region")
+	if region == "" && awsRegionRegex.MatchString(parsedUrl.Host) {
+		region = parsedUrl.Host
+	}
+
+	// A sessionToken= query param (or its X-Amz-Security-Token spelling) only
+	// applies when the userinfo section didn't already carry a third
+	// bracketed session token segment.
+	if sessionToken == "" {
+		sessionToken = values.Get("sessionToken")
+		if sessionToken == "" {
+			sessionToken = values.Get("X-Amz-Security-Token")
+		}
+	}
+	values.Del("sessionToken")
+	values.Del("X-Amz-Security-Token")
+
+	// Promote the S3 request modifiers common enough to warrant a typed
+	// field; anything else stays in Params.
+	versionId := values.Get("versionId")
+	values.Del("versionId")
+	tagging := values.Get("tagging")
+	values.Del("tagging")
+	sse := values.Get("sse")
+	values.Del("sse")
+	sseKmsKeyId := values.Get("sseKmsKeyId")
+	values.Del("sseKmsKeyId")
+	storageClass := values.Get("storageClass")
+	values.Del("storageClass")
+	acl := values.Get("acl")
+	values.Del("acl")
+
 	// Populate the S3Config struct with the extracted and decoded values
 	s3Config = S3Config{
-		AccessKeyId:  accessKeyID,
-		SecretKey:    secretKey,
-		Bucket:       bucketName,
-		Prefix:       bucketPrefix,
-		Endpoint:     "https://" + parsedUrl.Host,
-		EndpointHost: parsedUrl.Host,
-		Params:       values,
+		AccessKeyId:      accessKeyID,
+		SecretKey:        secretKey,
+		SessionToken:     sessionToken,
+		Bucket:           bucketName,
+		Prefix:           bucketPrefix,
+		Endpoint:         protocol + "://" + parsedUrl.Host,
+		EndpointHost:     parsedUrl.Host,
+		Region:           region,
+		CredentialSource: credentialSource,
+		VersionId:        versionId,
+		Tagging:          tagging,
+		SSE:              sse,
+		SSEKMSKeyId:      sseKmsKeyId,
+		StorageClass:     storageClass,
+		ACL:              acl,
+		Params:           values,
 	}
 
-	// Validate the configuration
-	if err = s3Config.Validate(); err != nil {
+	// Validate the shape of the configuration; credentials may still need
+	// Resolve to run before the config is usable.
+	if err = s3Config.ValidateShape(); err != nil {
 		return s3Config, err
 	}
 